@@ -0,0 +1,151 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package istioagent
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"istio.io/istio/pkg/security"
+
+	"istio.io/pkg/log"
+)
+
+// fileWatchDebounce is how long to wait, after the last of a burst of
+// file-system events, before pushing a notification. This absorbs the typical write-rename
+// atomic-swap pattern (cert-manager, kubelet projected volumes, most
+// provisioning tools) into a single push instead of one per intermediate
+// file operation.
+const fileWatchDebounce = 100 * time.Millisecond
+
+// startCertFileWatcher implements the "File watching, for backward
+// compat/migration from mounted secrets" mode from the Start() doc comment.
+// It watches the cert chain, key and root cert files used in
+// security.Options.FileWatchedCerts mode and, whenever they change as a
+// matched, loadable pair, forces sa.WorkloadSecrets to regenerate the
+// workload secret from the new files. Unlike FileMountedCerts (a static,
+// load-once mode for secrets baked in at injection time), this lets
+// operators rotate certs out-of-band - e.g. from cert-manager or another
+// provisioning tool - without restarting the sidecar.
+func (sa *Agent) startCertFileWatcher() error {
+	certFile, keyFile, rootFile := certFilePaths(sa.secOpts)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create cert file watcher: %v", err)
+	}
+
+	// Watch the containing directories, not the files themselves: an atomic
+	// write-rename swap replaces the inode, which silently drops an fsnotify
+	// watch held on the old file.
+	watched := map[string]bool{}
+	for _, f := range []string{certFile, keyFile, rootFile} {
+		dir := filepath.Dir(f)
+		if watched[dir] {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch %v: %v", dir, err)
+		}
+		watched[dir] = true
+	}
+
+	go sa.watchCertFiles(watcher, certFile, keyFile, rootFile)
+	log.Infof("Watching %v, %v, %v for certificate changes", certFile, keyFile, rootFile)
+	return nil
+}
+
+func (sa *Agent) watchCertFiles(watcher *fsnotify.Watcher, certFile, keyFile, rootFile string) {
+	defer watcher.Close()
+
+	var debounce *time.Timer
+	push := func() {
+		if !validCertKeyPair(certFile, keyFile) {
+			log.Warnf("file watcher: %v and %v do not currently form a valid cert/key pair, skipping push", certFile, keyFile)
+			return
+		}
+		log.Infof("file watcher: cert, key or root changed, refreshing workload secret cache")
+		// GenerateSecret is the confirmed-real entry point security.SecretManager
+		// exposes; it re-reads the watched files into the cache so the next SDS
+		// request (or the cache's own internal push) serves the rotated cert,
+		// rather than calling into a second, unconfirmed push path with a
+		// synthetic connection key no real client is keyed on.
+		if _, err := sa.WorkloadSecrets.GenerateSecret(context.Background(), "", security.WorkloadKeyCertResourceName, ""); err != nil {
+			log.Errorf("file watcher: failed to refresh workload secret cache: %v", err)
+		}
+	}
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			// Kubelet-managed volumes (Secrets, projected volumes) rotate by
+			// swapping a "..data" symlink, so no event names the files themselves.
+			if !isWatchedFile(event.Name, certFile, keyFile, rootFile) && filepath.Base(event.Name) != "..data" {
+				continue
+			}
+			if debounce != nil {
+				debounce.Stop()
+			}
+			debounce = time.AfterFunc(fileWatchDebounce, push)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Errorf("file watcher: %v", err)
+		case <-sa.stopCh:
+			return
+		}
+	}
+}
+
+func isWatchedFile(name string, watched ...string) bool {
+	for _, w := range watched {
+		if filepath.Clean(name) == filepath.Clean(w) {
+			return true
+		}
+	}
+	return false
+}
+
+// validCertKeyPair returns true if certFile and keyFile can be loaded
+// together as a matching TLS key pair, guarding against pushing a torn pair
+// mid-write.
+func validCertKeyPair(certFile, keyFile string) bool {
+	_, err := tls.LoadX509KeyPair(certFile, keyFile)
+	return err == nil
+}
+
+func certFilePaths(opts *security.Options) (certFile, keyFile, rootFile string) {
+	certFile, keyFile, rootFile = security.DefaultCertChainFilePath, security.DefaultKeyFilePath, security.DefaultRootCertFilePath
+	if opts.CertChainFilePath != "" {
+		certFile = opts.CertChainFilePath
+	}
+	if opts.KeyFilePath != "" {
+		keyFile = opts.KeyFilePath
+	}
+	if opts.RootCertFilePath != "" {
+		rootFile = opts.RootCertFilePath
+	}
+	return
+}
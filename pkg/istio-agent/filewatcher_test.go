@@ -0,0 +1,97 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package istioagent
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeSelfSignedCertKeyPair(t *testing.T, dir, certName, keyName string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	certFile = filepath.Join(dir, certName)
+	keyFile = filepath.Join(dir, keyName)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(certFile, certPEM, 0o644); err != nil {
+		t.Fatalf("failed to write cert file: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestValidCertKeyPair(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSignedCertKeyPair(t, dir, "cert.pem", "key.pem")
+
+	if !validCertKeyPair(certFile, keyFile) {
+		t.Errorf("validCertKeyPair(%v, %v) = false, want true for a matching pair", certFile, keyFile)
+	}
+
+	_, otherKeyFile := writeSelfSignedCertKeyPair(t, dir, "other-cert.pem", "other-key.pem")
+	if validCertKeyPair(certFile, otherKeyFile) {
+		t.Errorf("validCertKeyPair(%v, %v) = true, want false for a mismatched pair", certFile, otherKeyFile)
+	}
+
+	if validCertKeyPair(filepath.Join(dir, "missing-cert.pem"), keyFile) {
+		t.Errorf("validCertKeyPair with a missing cert file = true, want false")
+	}
+}
+
+func TestIsWatchedFile(t *testing.T) {
+	watched := []string{"/etc/certs/cert-chain.pem", "/etc/certs/key.pem"}
+
+	if !isWatchedFile("/etc/certs/cert-chain.pem", watched...) {
+		t.Errorf("isWatchedFile did not match an exact watched path")
+	}
+	if isWatchedFile("/etc/certs/root-cert.pem", watched...) {
+		t.Errorf("isWatchedFile matched a path that was not being watched")
+	}
+}
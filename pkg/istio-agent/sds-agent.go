@@ -15,13 +15,17 @@
 package istioagent
 
 import (
+	"context"
+	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/spiffe/go-spiffe/v2/proto/spiffe/workload"
 	"google.golang.org/grpc"
 
 	"istio.io/istio/pkg/adsc"
@@ -33,9 +37,13 @@ import (
 
 	"istio.io/istio/pilot/pkg/security/model"
 	"istio.io/istio/pkg/kube"
+	"istio.io/istio/security/pkg/credentialfetcher"
 	"istio.io/istio/security/pkg/nodeagent/cache"
-	citadel "istio.io/istio/security/pkg/nodeagent/caclient/providers/citadel"
-	gca "istio.io/istio/security/pkg/nodeagent/caclient/providers/google"
+	"istio.io/istio/security/pkg/nodeagent/caclient"
+	_ "istio.io/istio/security/pkg/nodeagent/caclient/providers/citadel" // registers the "Citadel" CA provider
+	_ "istio.io/istio/security/pkg/nodeagent/caclient/providers/google"  // registers the "GoogleCA" CA provider
+	_ "istio.io/istio/security/pkg/nodeagent/caclient/providers/spire"   // registers the "SPIRE" CA provider
+	_ "istio.io/istio/security/pkg/nodeagent/caclient/providers/vault"   // registers the "Vault" CA provider
 	"istio.io/istio/security/pkg/nodeagent/sds"
 	"istio.io/istio/security/pkg/nodeagent/secretfetcher"
 
@@ -92,8 +100,15 @@ type Agent struct {
 	// RootCert is the CA root certificate. It is loaded part of detecting the
 	// SDS operating mode - may be the Citadel CA, Kubernentes CA or a custom
 	// CA. If not set it should be assumed we are using a public certificate (like ACME).
+	//
+	// Written from both Start() and the trustBundles.Run background goroutine
+	// (via onTrustBundleUpdate) whenever federated trust domains are
+	// configured, so all writes go through setRootCert and external readers
+	// should prefer GetRootCert over reading the field directly.
 	RootCert []byte
 
+	rootCertMu sync.RWMutex
+
 	// WorkloadSecrets is the interface used to get secrets. The SDS agent
 	// is calling this.
 	WorkloadSecrets security.SecretManager
@@ -119,12 +134,44 @@ type Agent struct {
 
 	xdsServer *xds.SimpleServer
 
+	// workloadAPIServer is the optional SPIFFE Workload API gRPC server,
+	// set when AgentConfig.EnableWorkloadAPI is true.
+	workloadAPIServer *grpc.Server
+
 	cfg     *AgentConfig
 	secOpts *security.Options
 
 	stopCh chan struct{}
 
 	ADSC *adsc.ADSC
+
+	// systemRootCAOnce/systemRootCAPath cache the result of resolving the OS
+	// trust-store bundle - see SystemRootCAPath().
+	systemRootCAOnce sync.Once
+	systemRootCAPath string
+
+	// trustBundles holds the federated trust bundles merged into the root
+	// cert served over SDS and used by the Citadel client, keyed by trust
+	// domain. See TrustBundleStore.
+	trustBundles *TrustBundleStore
+}
+
+// setRootCert stores root as the current RootCert under rootCertMu, so
+// concurrent writes from Start and the trustBundles.Run background
+// goroutine (via onTrustBundleUpdate) can't race.
+func (sa *Agent) setRootCert(root []byte) {
+	sa.rootCertMu.Lock()
+	defer sa.rootCertMu.Unlock()
+	sa.RootCert = root
+}
+
+// GetRootCert returns the current RootCert, safe to call concurrently with
+// the trustBundles.Run background goroutine's updates. Prefer this over
+// reading the RootCert field directly.
+func (sa *Agent) GetRootCert() []byte {
+	sa.rootCertMu.RLock()
+	defer sa.rootCertMu.RUnlock()
+	return sa.RootCert
 }
 
 // AgentConfig contains additional config for the agent, not included in ProxyConfig.
@@ -140,6 +187,37 @@ type AgentConfig struct {
 	// PlainTLS indicates the use of plain TLS for XDS connection. This will not use client
 	// certificates, but JWT.
 	PlainTLS bool
+
+	// EnableWorkloadAPI, if set, makes the agent also expose a SPIFFE Workload
+	// API-compatible gRPC endpoint on WorkloadAPISocket, backed by the same
+	// WorkloadSecrets cache used for Envoy SDS. This allows non-Envoy
+	// workloads (go-spiffe clients, databases, sidecar-less pods) to
+	// authenticate against Istiod's CA through this agent.
+	EnableWorkloadAPI bool
+
+	// WorkloadAPISocket is the UDS path the SPIFFE Workload API is served
+	// on, required when EnableWorkloadAPI is set. Must be distinct from
+	// LocalSDS - the Envoy SDS API and the Workload API are two different
+	// gRPC services and cannot share one listener.
+	WorkloadAPISocket string
+
+	// FederatedTrustDomains maps a SPIFFE trust domain to the SPIFFE bundle
+	// endpoint URL it should be federated from, in addition to any static
+	// bundles in security.Options.TrustBundles. See TrustBundleStore.
+	FederatedTrustDomains map[string]string
+
+	// CredentialFetcher, if set, is used instead of the mounted JWTPath to
+	// obtain the credential the agent presents to the CA - e.g. a GCE, AWS
+	// or Azure IMDS plugin from security/pkg/credentialfetcher/plugin, for
+	// workloads running outside K8s. Takes precedence over
+	// CREDENTIAL_FETCHER_TYPE.
+	CredentialFetcher security.CredentialFetcher
+
+	// CredentialFetcherType selects a built-in credential fetcher by name
+	// (see security/pkg/credentialfetcher.NewCredFetcher) when
+	// CredentialFetcher is not set directly. Defaults to the
+	// CREDENTIAL_FETCHER_TYPE env variable.
+	CredentialFetcherType string
 }
 
 // NewAgent wraps the logic for a local SDS. It will check if the JWT token required for local SDS is
@@ -149,13 +227,19 @@ type AgentConfig struct {
 // If the JWT token is not present, and cannot be fetched through the credential fetcher - the local SDS agent can't authenticate.
 //
 // If node agent and JWT are mounted: it indicates user injected a config using hostPath, and will be used.
+//
+// credentialFetcher generalizes this: cfg.CredentialFetcher (or a built-in
+// plugin selected by cfg.CredentialFetcherType / CREDENTIAL_FETCHER_TYPE)
+// supplies the credential instead of the mounted JWTPath, for VM workloads
+// on GCE, AWS or Azure that have no K8s-issued service-account token.
 func NewAgent(proxyConfig *mesh.ProxyConfig, cfg *AgentConfig,
 	sopts *security.Options) *Agent {
 	sa := &Agent{
-		proxyConfig: proxyConfig,
-		cfg:         cfg,
-		secOpts:     sopts,
-		stopCh:      make(chan struct{}),
+		proxyConfig:  proxyConfig,
+		cfg:          cfg,
+		secOpts:      sopts,
+		stopCh:       make(chan struct{}),
+		trustBundles: newTrustBundleStore(sopts.TrustBundles),
 	}
 
 	// Fix the defaults - mainly for tests ( main uses env )
@@ -173,6 +257,28 @@ func NewAgent(proxyConfig *mesh.ProxyConfig, cfg *AgentConfig,
 	//   the short lived certs.
 	// - if a JWTPath token exists, or can be fetched by credential fetcher, it will be included in the request.
 
+	// Resolve the credential fetcher: an explicit cfg.CredentialFetcher wins,
+	// otherwise fall back to a built-in plugin selected by
+	// cfg.CredentialFetcherType or CREDENTIAL_FETCHER_TYPE. This is what lets
+	// VM workloads on GCE, AWS or Azure authenticate to the CA without a
+	// mounted K8s service-account JWT.
+	if cfg.CredentialFetcher != nil {
+		sa.secOpts.CredFetcher = cfg.CredentialFetcher
+	} else {
+		credFetcherType := cfg.CredentialFetcherType
+		if credFetcherType == "" {
+			credFetcherType = os.Getenv("CREDENTIAL_FETCHER_TYPE")
+		}
+		if credFetcherType != "" {
+			fetcher, err := credentialfetcher.NewCredFetcher(credFetcherType, sopts.TrustDomain, sopts.JWTPath)
+			if err != nil {
+				log.Errorf("failed to create credential fetcher of type %v: %v", credFetcherType, err)
+			} else {
+				sa.secOpts.CredFetcher = fetcher
+			}
+		}
+	}
+
 	// If original /etc/certs or a separate 'provisioning certs' (VM) are present,
 	// add them to the tlsContext. If server asks for them and they exist - will be provided.
 
@@ -219,7 +325,9 @@ func NewAgent(proxyConfig *mesh.ProxyConfig, cfg *AgentConfig,
 //
 // 3. Monitor mode - watching secret in same namespace ( Ingress)
 //
-// 4. TODO: File watching, for backward compat/migration from mounted secrets.
+// 4. File watching (security.Options.FileWatchedCerts), for backward
+//    compat/migration from mounted secrets - coexists with the static
+//    FileMountedCerts mode, but pushes on rotation instead of loading once.
 func (sa *Agent) Start(isSidecar bool, podNamespace string) (*sds.Server, error) {
 
 	// TODO: remove the caching, workload has a single cert
@@ -227,6 +335,17 @@ func (sa *Agent) Start(isSidecar bool, podNamespace string) (*sds.Server, error)
 		sa.WorkloadSecrets, _ = sa.newWorkloadSecretCache()
 	}
 
+	if sa.secOpts.FileWatchedCerts {
+		if err := sa.startCertFileWatcher(); err != nil {
+			return nil, err
+		}
+	}
+
+	for trustDomain, endpoint := range sa.cfg.FederatedTrustDomains {
+		sa.trustBundles.AddProvider(newHTTPSBundleProvider(trustDomain, endpoint))
+	}
+	go sa.trustBundles.Run(sa.stopCh, sa.onTrustBundleUpdate)
+
 	var gatewaySecretCache *cache.SecretCache
 	if !isSidecar {
 		if gatewaySdsExists() {
@@ -246,12 +365,55 @@ func (sa *Agent) Start(isSidecar bool, podNamespace string) (*sds.Server, error)
 		return nil, err
 	}
 
+	if sa.cfg.EnableWorkloadAPI {
+		if err := sa.startWorkloadAPI(); err != nil {
+			return nil, err
+		}
+	}
+
 	// Start the XDS client and proxy.
 	sa.startXDS(sa.proxyConfig, sa.WorkloadSecrets)
 
 	return server, nil
 }
 
+// startWorkloadAPI registers the SPIFFE Workload API gRPC service on its own
+// listener at cfg.WorkloadAPISocket, alongside (but separate from) the Envoy
+// SDS API served by sds.Server, so non-Envoy workloads can fetch SVIDs
+// through this agent. It needs its own socket: sds.Server already owns
+// LocalSDS and only knows the Envoy SDS protocol, so reusing that path would
+// unlink the file out from under the running SDS listener and leave two
+// independent gRPC servers racing for the same path.
+func (sa *Agent) startWorkloadAPI() error {
+	socket := sa.cfg.WorkloadAPISocket
+	if socket == "" {
+		return fmt.Errorf("EnableWorkloadAPI requires WorkloadAPISocket to be set to a path distinct from %v", LocalSDS)
+	}
+	if socket == LocalSDS {
+		return fmt.Errorf("WorkloadAPISocket must not be %v: that socket is already served by the Envoy SDS API", LocalSDS)
+	}
+
+	_ = os.Remove(socket)
+	lis, err := net.Listen("unix", socket)
+	if err != nil {
+		return fmt.Errorf("failed to listen on workload API socket %v: %v", socket, err)
+	}
+
+	sa.workloadAPIServer = grpc.NewServer()
+	workload.RegisterSpiffeWorkloadAPIServer(sa.workloadAPIServer, newWorkloadAPIServer(
+		sa.WorkloadSecrets, sa.secOpts.TrustDomain, sa.secOpts.RecycleInterval,
+		sa.secOpts.TokenExchangers, sa.secOpts.CredFetcher))
+
+	go func() {
+		if err := sa.workloadAPIServer.Serve(lis); err != nil {
+			log.Errorf("SPIFFE Workload API server failed: %v", err)
+		}
+	}()
+
+	log.Infof("Started SPIFFE Workload API on %v", socket)
+	return nil
+}
+
 func gatewaySdsExists() bool {
 	p := strings.TrimPrefix(model.GatewaySdsUdsPath, "unix:")
 	dir := path.Dir(p)
@@ -281,7 +443,7 @@ func (sa *Agent) FindRootCAForXDS() string {
 
 	if sa.cfg.PlainTLS ||
 		strings.HasSuffix(sa.proxyConfig.DiscoveryAddress, ":443") {
-		return "/etc/ssl/certs/ca-certificates.crt"
+		return sa.systemRootCAOrDefault()
 	} else if sa.secOpts.PilotCertProvider == "istiod" {
 		// This is the default - a mounted config map on K8S
 		return "./var/run/secrets/istio/root-cert.pem"
@@ -289,15 +451,64 @@ func (sa *Agent) FindRootCAForXDS() string {
 		// Using K8S - this is likely incorrect, may work by accident.
 		// API is alpha.
 		return "./var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	} else if sa.secOpts.PilotCertProvider == "system" {
+		// Resolve the OS trust store at runtime instead of assuming a
+		// particular base image, so proxies talking to XDS endpoints fronted
+		// by a public CA (Let's Encrypt, GCP-managed certs) work regardless
+		// of the image the agent happens to run on.
+		return sa.systemRootCAOrDefault()
 	} else if sa.secOpts.ProvCert != "" {
 		// This was never completely correct - PROV_CERT are only intended for auth with CA_ADDR,
 		// and should not be involved in determining the root CA.
 		return sa.secOpts.ProvCert + "/root-cert.pem"
 	}
 	// Default to std certs.
+	return sa.systemRootCAOrDefault()
+}
+
+// SystemRootCAPath returns the path to the OS trust-store CA bundle on this
+// host, resolved once and cached. Used for PILOT_CERT_PROVIDER=system, as
+// FindRootCAForXDS's default, and by newWorkloadSecretCache as a fallback
+// when the configured root cert file cannot be read. FindRootCAForXDS does
+// not check that the istiod, kubernetes or PROV_CERT root files exist, so it
+// does not fall back for those.
+func (sa *Agent) SystemRootCAPath() string {
+	sa.systemRootCAOnce.Do(func() {
+		sa.systemRootCAPath = findSystemCABundle()
+	})
+	return sa.systemRootCAPath
+}
+
+// systemRootCAOrDefault returns the resolved OS trust-store bundle, falling
+// back to the historical hard-coded Debian path if none of the well-known
+// flat-file locations exist. That fallback is itself only valid on
+// Debian-family images: there is no file path this can return for
+// Windows/macOS platform stores (see the doc comment on findSystemCABundle),
+// so PILOT_CERT_PROVIDER=system on those platforms needs an explicit root
+// cert path configured instead.
+func (sa *Agent) systemRootCAOrDefault() string {
+	if p := sa.SystemRootCAPath(); p != "" {
+		return p
+	}
 	return "/etc/ssl/certs/ca-certificates.crt"
 }
 
+// onTrustBundleUpdate recomputes sa.RootCert from the latest federated trust
+// bundles and pushes the refreshed root through the one confirmed-real
+// entry point for that, GenerateSecret, so SDS/Workload API clients pick up
+// newly federated trust domains without the agent restarting. It is
+// trustBundles' onUpdate callback - TrustBundleStore has no connection to
+// push updates on itself.
+func (sa *Agent) onTrustBundleUpdate() {
+	sa.setRootCert(sa.trustBundles.MergedRoot())
+	if sa.WorkloadSecrets == nil {
+		return
+	}
+	if _, err := sa.WorkloadSecrets.GenerateSecret(context.Background(), "", security.RootCertReqResourceName, ""); err != nil {
+		log.Errorf("trust bundle: failed to refresh root cert secret: %v", err)
+	}
+}
+
 // newWorkloadSecretCache creates the cache for workload secrets and/or gateway secrets.
 func (sa *Agent) newWorkloadSecretCache() (workloadSecretCache *cache.SecretCache, caClient security.Client) {
 	fetcher := &secretfetcher.SecretFetcher{}
@@ -310,19 +521,37 @@ func (sa *Agent) newWorkloadSecretCache() (workloadSecretCache *cache.SecretCach
 
 	workloadSecretCache = cache.NewSecretCache(fetcher, sds.NotifyProxy, sa.secOpts)
 
-	// If proxy is using file mounted certs, we do not have to connect to CA.
-	if sa.secOpts.FileMountedCerts {
-		log.Info("Workload is using file mounted certificates. Skipping connecting to CA")
+	// If proxy is using file mounted or file-watched certs, we do not have to
+	// connect to CA: the cert/key/root bytes come from disk (loaded once for
+	// FileMountedCerts, re-loaded on rotation by startCertFileWatcher for
+	// FileWatchedCerts) rather than from a CSR round trip.
+	if sa.secOpts.FileMountedCerts || sa.secOpts.FileWatchedCerts {
+		log.Info("Workload is using file mounted or file-watched certificates. Skipping connecting to CA")
 		return
 	}
 
-	// TODO: this should all be packaged in a plugin, possibly with optional compilation.
-	log.Infof("sa.serverOptions.CAEndpoint == %v", sa.secOpts.CAEndpoint)
-	if sa.secOpts.CAProviderName == "GoogleCA" || strings.Contains(sa.secOpts.CAEndpoint, "googleapis.com") {
+	// Provider name resolution is CA-agnostic: the actual security.Client is
+	// built by whichever provider package (citadel, google, spire, vault, ...)
+	// registered itself under this name via caclient.RegisterCAProvider.
+	providerName := sa.secOpts.CAProviderName
+	if providerName == "" {
+		if strings.Contains(sa.secOpts.CAEndpoint, "googleapis.com") {
+			providerName = "GoogleCA"
+		} else {
+			providerName = "Citadel"
+		}
+	}
+
+	log.Infof("sa.serverOptions.CAEndpoint == %v, CA provider == %v", sa.secOpts.CAEndpoint, providerName)
+	if providerName == "GoogleCA" {
 		// Use a plugin to an external CA - this has direct support for the K8S JWT token
 		// This is only used if the proper env variables are injected - otherwise the existing Citadel or Istiod will be
 		// used.
-		caClient, err = gca.NewGoogleCAClient(sa.secOpts.CAEndpoint, true)
+		factory, ok := caclient.Lookup(providerName)
+		if !ok {
+			log.Fatalf("unknown CA provider %q - no caclient plugin registered under that name", providerName)
+		}
+		caClient, err = factory(sa.secOpts, nil)
 		sa.secOpts.PluginNames = []string{"GoogleTokenExchange"}
 	} else {
 		// Determine the default CA.
@@ -360,9 +589,26 @@ func (sa *Agent) newWorkloadSecretCache() (workloadSecretCache *cache.SecretCach
 				if rootCert, err = ioutil.ReadFile(security.DefaultRootCertFilePath); err != nil {
 					certReadErr = true
 				}
+			} else if sa.secOpts.PilotCertProvider == "system" {
+				log.Infof("istiod uses the OS trust store: %v", sa.SystemRootCAPath())
+				if rootCert, err = ioutil.ReadFile(sa.SystemRootCAPath()); err != nil {
+					certReadErr = true
+				}
 			} else {
 				certReadErr = true
 			}
+			if certReadErr {
+				// The configured root is missing - before giving up on TLS
+				// entirely, see if the OS trust store has something usable
+				// (e.g. the XDS endpoint is fronted by a public CA).
+				if p := sa.SystemRootCAPath(); p != "" {
+					if rc, rerr := ioutil.ReadFile(p); rerr == nil {
+						log.Infof("Falling back to OS trust store at %v", p)
+						rootCert = rc
+						certReadErr = false
+					}
+				}
+			}
 			if certReadErr {
 				rootCert = nil
 				// for debugging only
@@ -397,10 +643,27 @@ func (sa *Agent) newWorkloadSecretCache() (workloadSecretCache *cache.SecretCach
 					if rootCert, err = ioutil.ReadFile(security.DefaultRootCertFilePath); err != nil {
 						certReadErr = true
 					}
+				} else if sa.secOpts.PilotCertProvider == "system" {
+					log.Infof("istiod uses the OS trust store: %v", sa.SystemRootCAPath())
+					if rootCert, err = ioutil.ReadFile(sa.SystemRootCAPath()); err != nil {
+						certReadErr = true
+					}
 				} else {
 					log.Errorf("unknown cert provider %v", sa.secOpts.PilotCertProvider)
 					certReadErr = true
 				}
+				if certReadErr {
+					// Before failing hard, see if the OS trust store has
+					// something usable - e.g. the XDS endpoint on :15012 is
+					// fronted by a public CA rather than istiod's self-signed one.
+					if p := sa.SystemRootCAPath(); p != "" {
+						if rc, rerr := ioutil.ReadFile(p); rerr == nil {
+							log.Infof("Falling back to OS trust store at %v", p)
+							rootCert = rc
+							certReadErr = false
+						}
+					}
+				}
 				if certReadErr {
 					rootCert = nil
 					log.Fatal("invalid config - port 15012 missing a root certificate")
@@ -418,13 +681,32 @@ func (sa *Agent) newWorkloadSecretCache() (workloadSecretCache *cache.SecretCach
 
 		// rootCert is used as a bundle - it can include multiple root certs !
 		// If nil, the 'system' (public CA) roots are used to connect to the CA.
-		sa.RootCert = rootCert
+		// Fold in any federated trust bundles, so the Citadel client (and,
+		// via sa.RootCert, anything else reading it) can validate peers from
+		// other SPIFFE trust domains as well as our own. rootCert is recorded
+		// in trustBundles itself so Start's trustBundles.Run callback can
+		// redo this merge whenever a federated bundle is refreshed in the
+		// background, without racing this goroutine over a copy on Agent.
+		sa.trustBundles.SetLocalRoot(rootCert)
+		sa.setRootCert(sa.trustBundles.MergedRoot())
 
 		// Will use TLS unless the reserved 15010 port is used ( istiod on an ipsec/secure VPC)
 		// rootCert may be nil - in which case the system roots are used, and the CA is expected to have public key
 		// Otherwise assume the injection has mounted /etc/certs/root-cert.pem
-		caClient, err = citadel.NewCitadelClient(sa.secOpts.CAEndpoint, tls, rootCert, sa.secOpts.ClusterID)
-		if err == nil {
+		sa.secOpts.TLSEnabled = tls
+
+		factory, ok := caclient.Lookup(providerName)
+		if !ok {
+			log.Fatalf("unknown CA provider %q - no caclient plugin registered under that name", providerName)
+		}
+		// The client gets the merged bundle; a nil rootCert is passed on as
+		// nil so that the system roots stay in use.
+		caRoot := rootCert
+		if caRoot != nil {
+			caRoot = sa.GetRootCert()
+		}
+		caClient, err = factory(sa.secOpts, caRoot)
+		if err == nil && providerName == "Citadel" {
 			sa.CitadelClient = caClient
 		}
 	}
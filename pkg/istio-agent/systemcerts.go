@@ -0,0 +1,63 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package istioagent
+
+import (
+	"crypto/x509"
+	"os"
+
+	"istio.io/pkg/log"
+)
+
+// systemCABundlePaths lists the well-known locations of the OS CA bundle
+// across the base images the agent needs to run on - these differ by distro
+// even though they all serve the same purpose as "/etc/ssl/certs/ca-certificates.crt"
+// on Debian/Ubuntu, the path this agent historically hard-coded.
+var systemCABundlePaths = []string{
+	"/etc/ssl/certs/ca-certificates.crt", // Debian/Ubuntu, Gentoo, Arch
+	"/etc/pki/tls/certs/ca-bundle.crt",   // RHEL/CentOS/Fedora
+	"/etc/ssl/cert.pem",                  // Alpine, macOS (via Homebrew openssl), OpenBSD
+	"/etc/ssl/ca-bundle.pem",             // SUSE
+}
+
+// findSystemCABundle returns the path to the first existing OS CA bundle
+// found on disk, or "" if none of the well-known flat-file locations exist.
+// Windows (and stock macOS) keep trust in a platform store rather than a
+// single bundle file, and crypto/x509 has no API to re-serialize
+// x509.SystemCertPool() back out to a file - only to an in-process
+// *x509.CertPool - so there is no file path this function can hand back on
+// those platforms. Since Envoy's bootstrap config needs an on-disk file,
+// callers there must configure an explicit root cert path rather than rely
+// on this fallback.
+func findSystemCABundle() string {
+	for _, p := range systemCABundlePaths {
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	if !systemCertPoolAvailable() {
+		log.Warnf("system trust store: no well-known CA bundle file found, and no system cert pool is available on this platform")
+	}
+	return ""
+}
+
+// systemCertPoolAvailable reports whether the Go runtime can load this
+// host's platform trust store at all. It exists purely for the diagnostic
+// above: crypto/x509 gives no way to turn the resulting *x509.CertPool back
+// into a file findSystemCABundle could return.
+func systemCertPoolAvailable() bool {
+	pool, err := x509.SystemCertPool()
+	return err == nil && pool != nil
+}
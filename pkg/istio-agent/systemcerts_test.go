@@ -0,0 +1,43 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package istioagent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindSystemCABundle(t *testing.T) {
+	origPaths := systemCABundlePaths
+	defer func() { systemCABundlePaths = origPaths }()
+
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "does-not-exist.pem")
+	present := filepath.Join(dir, "ca-bundle.pem")
+	if err := os.WriteFile(present, []byte("fake bundle"), 0o644); err != nil {
+		t.Fatalf("failed to write fake bundle: %v", err)
+	}
+
+	systemCABundlePaths = []string{missing, present}
+	if got := findSystemCABundle(); got != present {
+		t.Errorf("findSystemCABundle() = %v, want %v", got, present)
+	}
+
+	systemCABundlePaths = []string{missing}
+	if got := findSystemCABundle(); got != "" {
+		t.Errorf("findSystemCABundle() = %v, want \"\" when no bundle file exists", got)
+	}
+}
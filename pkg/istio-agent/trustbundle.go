@@ -0,0 +1,180 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package istioagent
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"istio.io/pkg/log"
+)
+
+// trustBundleRefreshInterval is how often registered TrustBundleProviders
+// are polled for an updated bundle.
+const trustBundleRefreshInterval = 5 * time.Minute
+
+// TrustBundleProvider supplies the current trust bundle (PEM-encoded root
+// certificates) for a single federated trust domain. The only implementation
+// today, httpsBundleProvider, polls a SPIFFE bundle endpoint over HTTPS; the
+// interface itself doesn't assume polling, so a future push-based source
+// (e.g. an XDS watch) can implement it too by calling FetchBundle's stored
+// result eagerly and returning it again, unchanged, when Run polls.
+type TrustBundleProvider interface {
+	// TrustDomain is the SPIFFE trust domain this provider supplies a bundle for.
+	TrustDomain() string
+	// FetchBundle returns the current root bundle, PEM-encoded. Called
+	// periodically by TrustBundleStore.Run - implementations do not need to
+	// cache or debounce themselves.
+	FetchBundle(ctx context.Context) ([]byte, error)
+}
+
+// TrustBundleStore maintains a federated set of trust bundles keyed by trust
+// domain, seeded from security.Options.TrustBundles and kept up to date by
+// any registered TrustBundleProviders. The merged result is folded into the
+// root cert served over SDS for the "default" resource and into the Citadel
+// client's TLS config, so workloads can validate peers from federated
+// meshes whose SPIFFE trust domain differs from TRUST_DOMAIN.
+type TrustBundleStore struct {
+	mu        sync.RWMutex
+	bundles   map[string][]byte // trust domain -> PEM bundle
+	localRoot []byte            // non-federated root, set once via SetLocalRoot
+	providers []TrustBundleProvider
+}
+
+// newTrustBundleStore creates a store seeded with the static bundles in
+// seed (typically security.Options.TrustBundles). seed may be nil.
+func newTrustBundleStore(seed map[string][]byte) *TrustBundleStore {
+	bundles := make(map[string][]byte, len(seed))
+	for td, b := range seed {
+		bundles[td] = b
+	}
+	return &TrustBundleStore{bundles: bundles}
+}
+
+// AddProvider registers p to be polled by Run. Not safe to call once Run
+// has started.
+func (t *TrustBundleStore) AddProvider(p TrustBundleProvider) {
+	t.providers = append(t.providers, p)
+}
+
+// Merge appends every known federated trust bundle to localRoot and returns
+// the result. localRoot may be nil.
+func (t *TrustBundleStore) Merge(localRoot []byte) []byte {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.mergeLocked(localRoot)
+}
+
+func (t *TrustBundleStore) mergeLocked(localRoot []byte) []byte {
+	if len(t.bundles) == 0 {
+		return localRoot
+	}
+
+	out := append([]byte{}, localRoot...)
+	for _, b := range t.bundles {
+		if len(out) > 0 && out[len(out)-1] != '\n' {
+			out = append(out, '\n')
+		}
+		out = append(out, b...)
+	}
+	return out
+}
+
+// SetLocalRoot records root - the root cert resolved from
+// istiod/Kubernetes/a custom path/the system trust store, before any
+// federated trust bundles are merged in - so MergedRoot can redo that merge
+// later against whatever bundles Run's background refresh has picked up
+// since. Guarded by the store's mutex; callers set it once, synchronously,
+// before starting Run.
+func (t *TrustBundleStore) SetLocalRoot(root []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.localRoot = root
+}
+
+// MergedRoot returns the root set via SetLocalRoot merged with every known
+// federated trust bundle - the thread-safe combination of SetLocalRoot and
+// Merge, so callers never need to keep their own copy of localRoot around
+// to pass back into Merge from a different goroutine.
+func (t *TrustBundleStore) MergedRoot() []byte {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.mergeLocked(t.localRoot)
+}
+
+// Run polls every registered provider on trustBundleRefreshInterval until
+// stopCh is closed, calling onUpdate whenever any bundle actually changes.
+// onUpdate is the caller's hook to recompute whatever merges these bundles
+// into the root cert served over SDS/the Workload API and push a fresh one
+// out - TrustBundleStore itself has no connection to push on, so it cannot
+// notify SDS clients directly.
+func (t *TrustBundleStore) Run(stopCh <-chan struct{}, onUpdate func()) {
+	if len(t.providers) == 0 {
+		return
+	}
+
+	if t.refreshAll() && onUpdate != nil {
+		onUpdate()
+	}
+
+	ticker := time.NewTicker(trustBundleRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if t.refreshAll() && onUpdate != nil {
+				onUpdate()
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// refreshAll polls every registered provider once and reports whether any
+// of them produced a changed bundle.
+func (t *TrustBundleStore) refreshAll() bool {
+	changed := false
+	for _, p := range t.providers {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		bundle, err := p.FetchBundle(ctx)
+		cancel()
+		if err != nil {
+			log.Warnf("trust bundle: failed to refresh trust domain %v: %v", p.TrustDomain(), err)
+			continue
+		}
+		if !t.update(p.TrustDomain(), bundle) {
+			continue
+		}
+		log.Infof("trust bundle: updated for trust domain %v", p.TrustDomain())
+		changed = true
+	}
+	return changed
+}
+
+// update stores bundle for trustDomain and reports whether it actually
+// changed anything - used to avoid notifying on every poll when nothing
+// federated has rotated.
+func (t *TrustBundleStore) update(trustDomain string, bundle []byte) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if bytes.Equal(t.bundles[trustDomain], bundle) {
+		return false
+	}
+	t.bundles[trustDomain] = bundle
+	return true
+}
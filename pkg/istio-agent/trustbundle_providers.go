@@ -0,0 +1,97 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package istioagent
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// httpsBundleProvider fetches a federated trust domain's bundle from its
+// SPIFFE Trust Domain bundle endpoint
+// (https://github.com/spiffe/spiffe/blob/main/standards/SPIFFE_Trust_Domain_and_Bundle.md#4-spiffe-bundle-endpoint),
+// which serves a JWKS document whose "keys" each carry an x5c certificate
+// chain.
+type httpsBundleProvider struct {
+	trustDomain string
+	endpoint    string
+	client      *http.Client
+}
+
+// newHTTPSBundleProvider polls endpoint (a SPIFFE bundle endpoint URL) for
+// trustDomain's federated root bundle.
+func newHTTPSBundleProvider(trustDomain, endpoint string) TrustBundleProvider {
+	return &httpsBundleProvider{
+		trustDomain: trustDomain,
+		endpoint:    endpoint,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (h *httpsBundleProvider) TrustDomain() string {
+	return h.trustDomain
+}
+
+type spiffeJWKS struct {
+	Keys []struct {
+		X5c []string `json:"x5c"`
+	} `json:"keys"`
+}
+
+func (h *httpsBundleProvider) FetchBundle(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch bundle endpoint %v: %v", h.endpoint, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bundle endpoint %v returned %v", h.endpoint, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var jwks spiffeJWKS
+	if err := json.Unmarshal(body, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to parse bundle endpoint response as JWKS: %v", err)
+	}
+
+	var out []byte
+	for _, k := range jwks.Keys {
+		for _, x5c := range k.X5c {
+			der, err := base64.StdEncoding.DecodeString(x5c)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode x5c certificate: %v", err)
+			}
+			out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("bundle endpoint %v returned no certificates", h.endpoint)
+	}
+	return out, nil
+}
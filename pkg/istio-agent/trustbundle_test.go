@@ -0,0 +1,104 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package istioagent
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestTrustBundleStoreMerge(t *testing.T) {
+	store := newTrustBundleStore(map[string][]byte{
+		"federated.example": []byte("federated-root"),
+	})
+
+	got := string(store.Merge([]byte("local-root")))
+	if got != "local-root\nfederated-root" {
+		t.Errorf("Merge() = %q, want %q", got, "local-root\nfederated-root")
+	}
+
+	emptyStore := newTrustBundleStore(nil)
+	if got := emptyStore.Merge([]byte("local-root")); string(got) != "local-root" {
+		t.Errorf("Merge() with no federated bundles = %q, want %q", got, "local-root")
+	}
+}
+
+func TestTrustBundleStoreSetLocalRootMergedRoot(t *testing.T) {
+	store := newTrustBundleStore(map[string][]byte{
+		"federated.example": []byte("federated-root"),
+	})
+
+	store.SetLocalRoot([]byte("local-root"))
+	got := string(store.MergedRoot())
+	if got != "local-root\nfederated-root" {
+		t.Errorf("MergedRoot() = %q, want %q", got, "local-root\nfederated-root")
+	}
+
+	if !store.update("federated.example", []byte("rotated-root")) {
+		t.Fatalf("update() with a changed bundle = false, want true")
+	}
+	got = string(store.MergedRoot())
+	if got != "local-root\nrotated-root" {
+		t.Errorf("MergedRoot() after a bundle refresh = %q, want %q", got, "local-root\nrotated-root")
+	}
+}
+
+func TestTrustBundleStoreUpdate(t *testing.T) {
+	store := newTrustBundleStore(nil)
+
+	if !store.update("td1", []byte("bundle-1")) {
+		t.Errorf("update() with a new trust domain = false, want true")
+	}
+	if store.update("td1", []byte("bundle-1")) {
+		t.Errorf("update() with an unchanged bundle = true, want false")
+	}
+	if !store.update("td1", []byte("bundle-2")) {
+		t.Errorf("update() with a changed bundle = false, want true")
+	}
+}
+
+type fakeBundleProvider struct {
+	trustDomain string
+	bundle      []byte
+	err         error
+}
+
+func (f *fakeBundleProvider) TrustDomain() string { return f.trustDomain }
+
+func (f *fakeBundleProvider) FetchBundle(_ context.Context) ([]byte, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.bundle, nil
+}
+
+func TestTrustBundleStoreRefreshAll(t *testing.T) {
+	store := newTrustBundleStore(nil)
+	p := &fakeBundleProvider{trustDomain: "td1", bundle: []byte("bundle-1")}
+	store.AddProvider(p)
+
+	if !store.refreshAll() {
+		t.Errorf("refreshAll() = false on first fetch, want true")
+	}
+	if store.refreshAll() {
+		t.Errorf("refreshAll() = true when the bundle did not change, want false")
+	}
+
+	p.err = fmt.Errorf("fetch failed")
+	if store.refreshAll() {
+		t.Errorf("refreshAll() = true when the provider errored, want false")
+	}
+}
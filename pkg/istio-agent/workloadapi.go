@@ -0,0 +1,299 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package istioagent
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/proto/spiffe/workload"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"istio.io/istio/pkg/security"
+
+	"istio.io/pkg/log"
+)
+
+// WorkloadResourceName is the SDS resource name used to fetch the single
+// per-workload certificate from the SecretManager - the same name the
+// Envoy SDS API asks for.
+const WorkloadResourceName = "default"
+
+// defaultWorkloadAPIRefresh is how often FetchX509SVID/FetchX509Bundles
+// re-check the SecretManager for a rotated cert when the caller did not
+// configure security.Options.RecycleInterval. security.SecretManager has no
+// per-item change notification - GenerateSecret is the only contract it
+// offers - so polling it on this cadence, and only re-sending when the
+// bytes actually changed, is how rotation gets picked up.
+const defaultWorkloadAPIRefresh = 5 * time.Minute
+
+// workloadAPIServer implements the SPIFFE Workload API
+// (https://github.com/spiffe/spiffe/blob/main/standards/SPIFFE_Workload_API.md)
+// on top of the same WorkloadSecrets cache used to serve Envoy SDS. This lets
+// non-Envoy workloads (go-spiffe clients, databases, sidecar-less pods) fetch
+// and rotate SVIDs from the same per-pod agent, without understanding the
+// Envoy SDS protocol.
+type workloadAPIServer struct {
+	secrets         security.SecretManager
+	trustDomain     string
+	refreshInterval time.Duration
+	tokenExchangers []security.TokenExchanger
+	credFetcher     security.CredentialFetcher
+}
+
+// newWorkloadAPIServer wraps secrets (the same cache used for Envoy SDS) as
+// a SPIFFE Workload API implementation for trustDomain. tokenExchangers and
+// credFetcher back FetchJWTSVID - without at least one configured token
+// exchanger, JWT-SVID requests are refused.
+func newWorkloadAPIServer(secrets security.SecretManager, trustDomain string, refreshInterval time.Duration,
+	tokenExchangers []security.TokenExchanger, credFetcher security.CredentialFetcher) *workloadAPIServer {
+	if refreshInterval <= 0 {
+		refreshInterval = defaultWorkloadAPIRefresh
+	}
+	return &workloadAPIServer{
+		secrets:         secrets,
+		trustDomain:     trustDomain,
+		refreshInterval: refreshInterval,
+		tokenExchangers: tokenExchangers,
+		credFetcher:     credFetcher,
+	}
+}
+
+// FetchX509SVID returns the workload's X.509 SVID, and continues streaming
+// updated responses as the underlying certificate is rotated.
+func (w *workloadAPIServer) FetchX509SVID(_ *workload.X509SVIDRequest, stream workload.SpiffeWorkloadAPI_FetchX509SVIDServer) error {
+	ticker := time.NewTicker(w.refreshInterval)
+	defer ticker.Stop()
+
+	var lastChain []byte
+	for {
+		item, err := w.secrets.GenerateSecret(stream.Context(), "", WorkloadResourceName, "")
+		if err != nil {
+			log.Errorf("workload API: failed to generate X509 SVID: %v", err)
+			return err
+		}
+
+		if !bytes.Equal(item.CertificateChain, lastChain) {
+			spiffeID, err := spiffeIDFromCertChain(item.CertificateChain)
+			if err != nil {
+				log.Errorf("workload API: failed to derive SPIFFE ID: %v", err)
+				return err
+			}
+
+			resp := &workload.X509SVIDResponse{
+				Svids: []*workload.X509SVID{{
+					SpiffeId:    spiffeID,
+					X509Svid:    item.CertificateChain,
+					X509SvidKey: item.PrivateKey,
+					Bundle:      item.RootCert,
+				}},
+			}
+			if err := stream.Send(resp); err != nil {
+				return err
+			}
+			lastChain = item.CertificateChain
+		}
+
+		select {
+		case <-ticker.C:
+			continue
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// FetchX509Bundles streams the trust bundle(s) used to validate peer SVIDs,
+// re-pushing whenever the root changes (e.g. during a CA key rotation).
+func (w *workloadAPIServer) FetchX509Bundles(_ *workload.X509BundlesRequest, stream workload.SpiffeWorkloadAPI_FetchX509BundlesServer) error {
+	ticker := time.NewTicker(w.refreshInterval)
+	defer ticker.Stop()
+
+	var lastRoot []byte
+	for {
+		item, err := w.secrets.GenerateSecret(stream.Context(), "", security.RootCertReqResourceName, "")
+		if err != nil {
+			log.Errorf("workload API: failed to generate root bundle: %v", err)
+			return err
+		}
+
+		if !bytes.Equal(item.RootCert, lastRoot) {
+			resp := &workload.X509BundlesResponse{
+				Bundles: map[string][]byte{
+					w.trustDomain: item.RootCert,
+				},
+			}
+			if err := stream.Send(resp); err != nil {
+				return err
+			}
+			lastRoot = item.RootCert
+		}
+
+		select {
+		case <-ticker.C:
+			continue
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// FetchJWTSVID mints an audience-scoped JWT-SVID for the workload, by
+// exchanging the agent's own source credential (from the configured
+// security.CredentialFetcher) through the existing token exchanger plugins
+// - the same plugins used to authenticate this agent to the CA.
+func (w *workloadAPIServer) FetchJWTSVID(ctx context.Context, req *workload.JWTSVIDRequest) (*workload.JWTSVIDResponse, error) {
+	if len(req.Audience) == 0 {
+		return nil, fmt.Errorf("workload API: JWTSVIDRequest must specify at least one audience")
+	}
+	if len(w.tokenExchangers) == 0 {
+		return nil, fmt.Errorf("workload API: no token exchanger plugin configured for JWT-SVID minting")
+	}
+
+	var sourceToken string
+	if w.credFetcher != nil {
+		tok, err := w.credFetcher.GetPlatformCredential()
+		if err != nil {
+			return nil, fmt.Errorf("workload API: failed to fetch source credential: %v", err)
+		}
+		sourceToken = tok
+	}
+
+	audience := strings.Join(req.Audience, " ")
+	var svid string
+	var lastErr error
+	for _, ex := range w.tokenExchangers {
+		svid, _, _, lastErr = ex.ExchangeToken(ctx, audience, sourceToken)
+		if lastErr == nil {
+			break
+		}
+	}
+	if lastErr != nil {
+		return nil, fmt.Errorf("workload API: failed to mint JWT SVID for audience %v: %v", req.Audience, lastErr)
+	}
+
+	return &workload.JWTSVIDResponse{
+		Svids: []*workload.JWTSVID{{
+			SpiffeId: req.SpiffeId,
+			Svid:     svid,
+		}},
+	}, nil
+}
+
+// ValidateJWTSVID checks the expiry and audience of a JWT-SVID presented by
+// a peer. It only decodes the claims - it does not verify the signature,
+// since that needs a JWKS keyed by issuer and none is wired into the agent
+// yet. Callers that need cryptographic verification must still check the
+// signature themselves against a bundle fetched via FetchX509Bundles/an
+// external JWKS source.
+func (w *workloadAPIServer) ValidateJWTSVID(_ context.Context, req *workload.ValidateJWTSVIDRequest) (*workload.ValidateJWTSVIDResponse, error) {
+	claims, err := unverifiedJWTClaims(req.Svid)
+	if err != nil {
+		return nil, fmt.Errorf("workload API: failed to parse JWT-SVID: %v", err)
+	}
+	if err := checkJWTAudience(claims, req.Audience); err != nil {
+		return nil, err
+	}
+	if err := checkJWTExpiry(claims); err != nil {
+		return nil, err
+	}
+
+	spiffeID, _ := claims["sub"].(string)
+	claimsStruct, err := structpb.NewStruct(claims)
+	if err != nil {
+		return nil, fmt.Errorf("workload API: failed to encode claims: %v", err)
+	}
+	return &workload.ValidateJWTSVIDResponse{
+		SpiffeId: spiffeID,
+		Claims:   claimsStruct,
+	}, nil
+}
+
+// unverifiedJWTClaims decodes (without verifying) the payload segment of a
+// compact JWT.
+func unverifiedJWTClaims(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("not a valid compact JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode payload: %v", err)
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal claims: %v", err)
+	}
+	return claims, nil
+}
+
+func checkJWTAudience(claims map[string]interface{}, want []string) error {
+	if len(want) == 0 {
+		return nil
+	}
+	got := map[string]bool{}
+	switch aud := claims["aud"].(type) {
+	case string:
+		got[aud] = true
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				got[s] = true
+			}
+		}
+	}
+	for _, w := range want {
+		if !got[w] {
+			return fmt.Errorf("JWT-SVID audience does not include %v", w)
+		}
+	}
+	return nil
+}
+
+func checkJWTExpiry(claims map[string]interface{}) error {
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("JWT-SVID is missing an exp claim")
+	}
+	if time.Unix(int64(exp), 0).Before(time.Now()) {
+		return fmt.Errorf("JWT-SVID has expired")
+	}
+	return nil
+}
+
+// spiffeIDFromCertChain extracts the SPIFFE ID (the first URI SAN) of the
+// leaf certificate in a PEM-encoded chain, e.g.
+// spiffe://<trust domain>/ns/<ns>/sa/<sa>.
+func spiffeIDFromCertChain(certChain []byte) (string, error) {
+	block, _ := pem.Decode(certChain)
+	if block == nil {
+		return "", fmt.Errorf("failed to decode leaf certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse leaf certificate: %v", err)
+	}
+	if len(cert.URIs) == 0 {
+		return "", fmt.Errorf("leaf certificate has no URI SAN")
+	}
+	return cert.URIs[0].String(), nil
+}
@@ -0,0 +1,238 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package istioagent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/proto/spiffe/workload"
+	"google.golang.org/grpc"
+
+	"istio.io/istio/pkg/security"
+)
+
+func selfSignedLeafPEM(t *testing.T, spiffeID string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "workload"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if spiffeID != "" {
+		u, err := url.Parse(spiffeID)
+		if err != nil {
+			t.Fatalf("failed to parse spiffeID: %v", err)
+		}
+		tmpl.URIs = []*url.URL{u}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestSpiffeIDFromCertChain(t *testing.T) {
+	chain := selfSignedLeafPEM(t, "spiffe://cluster.local/ns/default/sa/sleep")
+	id, err := spiffeIDFromCertChain(chain)
+	if err != nil {
+		t.Fatalf("spiffeIDFromCertChain() returned error: %v", err)
+	}
+	if id != "spiffe://cluster.local/ns/default/sa/sleep" {
+		t.Errorf("spiffeIDFromCertChain() = %q, want %q", id, "spiffe://cluster.local/ns/default/sa/sleep")
+	}
+}
+
+func TestSpiffeIDFromCertChainNoURISAN(t *testing.T) {
+	chain := selfSignedLeafPEM(t, "")
+	if _, err := spiffeIDFromCertChain(chain); err == nil {
+		t.Fatalf("spiffeIDFromCertChain() = nil error, want error for a cert with no URI SAN")
+	}
+}
+
+func TestSpiffeIDFromCertChainNotPEM(t *testing.T) {
+	if _, err := spiffeIDFromCertChain([]byte("not pem at all")); err == nil {
+		t.Fatalf("spiffeIDFromCertChain() = nil error, want error for non-PEM input")
+	}
+}
+
+func fakeJWT(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	body, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("failed to marshal claims: %v", err)
+	}
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	payload := base64.RawURLEncoding.EncodeToString(body)
+	return header + "." + payload + ".sig"
+}
+
+func TestCheckJWTAudience(t *testing.T) {
+	claims := map[string]interface{}{"aud": []interface{}{"a", "b"}}
+	if err := checkJWTAudience(claims, []string{"a"}); err != nil {
+		t.Errorf("checkJWTAudience() = %v, want nil", err)
+	}
+	if err := checkJWTAudience(claims, []string{"c"}); err == nil {
+		t.Errorf("checkJWTAudience() = nil, want error for a missing audience")
+	}
+	if err := checkJWTAudience(claims, nil); err != nil {
+		t.Errorf("checkJWTAudience() with no requested audience = %v, want nil", err)
+	}
+}
+
+func TestCheckJWTExpiry(t *testing.T) {
+	future := map[string]interface{}{"exp": float64(time.Now().Add(time.Hour).Unix())}
+	if err := checkJWTExpiry(future); err != nil {
+		t.Errorf("checkJWTExpiry() with a future exp = %v, want nil", err)
+	}
+
+	past := map[string]interface{}{"exp": float64(time.Now().Add(-time.Hour).Unix())}
+	if err := checkJWTExpiry(past); err == nil {
+		t.Errorf("checkJWTExpiry() with a past exp = nil, want error")
+	}
+
+	if err := checkJWTExpiry(map[string]interface{}{}); err == nil {
+		t.Errorf("checkJWTExpiry() with no exp claim = nil, want error")
+	}
+}
+
+func TestValidateJWTSVID(t *testing.T) {
+	w := newWorkloadAPIServer(nil, "cluster.local", 0, nil, nil)
+	token := fakeJWT(t, map[string]interface{}{
+		"sub": "spiffe://cluster.local/ns/default/sa/sleep",
+		"aud": []interface{}{"target"},
+		"exp": float64(time.Now().Add(time.Hour).Unix()),
+	})
+
+	resp, err := w.ValidateJWTSVID(context.Background(), &workload.ValidateJWTSVIDRequest{
+		Svid:     token,
+		Audience: []string{"target"},
+	})
+	if err != nil {
+		t.Fatalf("ValidateJWTSVID() returned error: %v", err)
+	}
+	if resp.SpiffeId != "spiffe://cluster.local/ns/default/sa/sleep" {
+		t.Errorf("ValidateJWTSVID().SpiffeId = %q, want %q", resp.SpiffeId, "spiffe://cluster.local/ns/default/sa/sleep")
+	}
+}
+
+func TestValidateJWTSVIDExpired(t *testing.T) {
+	w := newWorkloadAPIServer(nil, "cluster.local", 0, nil, nil)
+	token := fakeJWT(t, map[string]interface{}{
+		"sub": "spiffe://cluster.local/ns/default/sa/sleep",
+		"exp": float64(time.Now().Add(-time.Hour).Unix()),
+	})
+
+	if _, err := w.ValidateJWTSVID(context.Background(), &workload.ValidateJWTSVIDRequest{Svid: token}); err == nil {
+		t.Fatalf("ValidateJWTSVID() = nil error, want error for an expired JWT-SVID")
+	}
+}
+
+// fakeSecretManager implements security.SecretManager by returning, in
+// order, the items queued in responses - one per GenerateSecret call, then
+// repeating the last one - so tests can drive a simulated rotation through
+// FetchX509SVID/FetchX509Bundles.
+type fakeSecretManager struct {
+	mu        sync.Mutex
+	responses []*security.SecretItem
+	calls     int
+}
+
+func (f *fakeSecretManager) GenerateSecret(_ context.Context, _, _, _ string) (*security.SecretItem, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.calls >= len(f.responses) {
+		return f.responses[len(f.responses)-1], nil
+	}
+	item := f.responses[f.calls]
+	f.calls++
+	return item, nil
+}
+
+// fakeX509SVIDStream implements workload.SpiffeWorkloadAPI_FetchX509SVIDServer
+// far enough to drive FetchX509SVID: it records every response sent and
+// closes done once want responses have arrived, so the test can cancel the
+// stream's context and stop FetchX509SVID's loop.
+type fakeX509SVIDStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent []*workload.X509SVIDResponse
+	done chan struct{}
+	want int
+}
+
+func (f *fakeX509SVIDStream) Context() context.Context { return f.ctx }
+
+func (f *fakeX509SVIDStream) Send(resp *workload.X509SVIDResponse) error {
+	f.sent = append(f.sent, resp)
+	if len(f.sent) >= f.want {
+		close(f.done)
+	}
+	return nil
+}
+
+func TestFetchX509SVIDOnlyResendsOnChange(t *testing.T) {
+	chain1 := selfSignedLeafPEM(t, "spiffe://cluster.local/ns/default/sa/sleep")
+	chain2 := selfSignedLeafPEM(t, "spiffe://cluster.local/ns/default/sa/sleep")
+	secrets := &fakeSecretManager{responses: []*security.SecretItem{
+		{CertificateChain: chain1, PrivateKey: []byte("key1"), RootCert: []byte("root")},
+		{CertificateChain: chain1, PrivateKey: []byte("key1"), RootCert: []byte("root")},
+		{CertificateChain: chain2, PrivateKey: []byte("key2"), RootCert: []byte("root")},
+	}}
+	w := newWorkloadAPIServer(secrets, "cluster.local", 5*time.Millisecond, nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := &fakeX509SVIDStream{ctx: ctx, done: make(chan struct{}), want: 2}
+
+	go func() {
+		_ = w.FetchX509SVID(nil, stream)
+	}()
+
+	select {
+	case <-stream.done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for the rotated SVID to be resent")
+	}
+	cancel()
+
+	if len(stream.sent) != 2 {
+		t.Fatalf("got %d responses, want exactly 2 (initial + one rotation)", len(stream.sent))
+	}
+	if string(stream.sent[0].Svids[0].X509Svid) != string(chain1) {
+		t.Errorf("first response chain = %q, want the initial chain", stream.sent[0].Svids[0].X509Svid)
+	}
+	if string(stream.sent[1].Svids[0].X509Svid) != string(chain2) {
+		t.Errorf("second response chain = %q, want the rotated chain", stream.sent[1].Svids[0].X509Svid)
+	}
+}
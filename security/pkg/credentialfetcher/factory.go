@@ -0,0 +1,67 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package credentialfetcher builds a security.CredentialFetcher for the
+// workload's environment, generalizing what used to be a single mounted K8s
+// JWT into a plugin surface usable on GCE/GKE, AWS, Azure, or any other
+// platform that can hand the agent a platform-specific identity credential.
+package credentialfetcher
+
+import (
+	"fmt"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/credentialfetcher/plugin"
+)
+
+// Recognized values for CREDENTIAL_FETCHER_TYPE / AgentConfig.CredentialFetcherType.
+const (
+	// JWTFetcherType is the default: read a token from a file on disk (the
+	// K8s-projected service-account token, or any other OIDC file-based
+	// token). This preserves the pre-existing mounted-JWT behavior.
+	JWTFetcherType = "JWT"
+
+	// GCEMetadataFetcherType fetches an identity token from the GCE/GKE
+	// instance metadata server.
+	GCEMetadataFetcherType = "GCEMetadata"
+
+	// AWSFetcherType fetches a signed instance identity document from AWS
+	// IMDSv2.
+	AWSFetcherType = "AWS"
+
+	// AzureFetcherType fetches a managed identity token from Azure IMDS.
+	AzureFetcherType = "Azure"
+)
+
+// NewCredFetcher returns the security.CredentialFetcher selected by
+// credFetcherType (typically the CREDENTIAL_FETCHER_TYPE env var or
+// AgentConfig.CredentialFetcherType), letting the operator pick whichever
+// platform credential source actually exists on this workload's
+// environment. audience is used as the requested token audience where the
+// platform supports one (GCE, Azure); jwtPath is only used by
+// JWTFetcherType.
+func NewCredFetcher(credFetcherType, audience, jwtPath string) (security.CredentialFetcher, error) {
+	switch credFetcherType {
+	case JWTFetcherType, "":
+		return plugin.CreateTokenPlugin(jwtPath), nil
+	case GCEMetadataFetcherType:
+		return plugin.CreateGCEPlugin(audience), nil
+	case AWSFetcherType:
+		return plugin.CreateAWSPlugin(), nil
+	case AzureFetcherType:
+		return plugin.CreateAzurePlugin(audience), nil
+	default:
+		return nil, fmt.Errorf("unknown credential fetcher type: %v", credFetcherType)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAWSPluginGetPlatformCredential(t *testing.T) {
+	origToken, origDoc := awsIMDSTokenURL, awsIdentityDocURL
+	defer func() { awsIMDSTokenURL, awsIdentityDocURL = origToken, origDoc }()
+
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("token request method = %v, want PUT", r.Method)
+		}
+		w.Write([]byte("fake-session-token"))
+	}))
+	defer tokenServer.Close()
+	awsIMDSTokenURL = tokenServer.URL
+
+	docServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-aws-ec2-metadata-token") != "fake-session-token" {
+			t.Errorf("request missing session token header")
+		}
+		w.Write([]byte("fake-identity-document"))
+	}))
+	defer docServer.Close()
+	awsIdentityDocURL = docServer.URL
+
+	p := CreateAWSPlugin()
+	doc, err := p.GetPlatformCredential()
+	if err != nil {
+		t.Fatalf("GetPlatformCredential() returned error: %v", err)
+	}
+	if doc != "fake-identity-document" {
+		t.Errorf("GetPlatformCredential() = %v, want fake-identity-document", doc)
+	}
+}
+
+func TestAWSPluginGetPlatformCredentialTokenError(t *testing.T) {
+	origToken := awsIMDSTokenURL
+	defer func() { awsIMDSTokenURL = origToken }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	awsIMDSTokenURL = server.URL
+
+	p := CreateAWSPlugin()
+	if _, err := p.GetPlatformCredential(); err == nil {
+		t.Fatalf("GetPlatformCredential() = nil error, want error when the session token endpoint fails")
+	}
+}
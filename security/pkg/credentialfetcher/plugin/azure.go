@@ -0,0 +1,86 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// azureIMDSTokenURL is a var, not a const, so tests can point it at an
+// httptest.Server instead of the real link-local IMDS address.
+var azureIMDSTokenURL = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+// AzurePlugin fetches a managed identity access token from Azure IMDS, so
+// an Azure VM can authenticate with the identity its managed identity
+// assignment already grants it, rather than a Kubernetes-projected token
+// that bare VMs have no kubelet to produce.
+type AzurePlugin struct {
+	resource string
+	client   *http.Client
+}
+
+// CreateAzurePlugin returns a security.CredentialFetcher requesting tokens
+// scoped to resource (the Azure AD application ID URI the CA expects).
+func CreateAzurePlugin(resource string) *AzurePlugin {
+	return &AzurePlugin{resource: resource, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+type azureIMDSTokenResponse struct {
+	AccessToken string `json:"access_token"`
+}
+
+// GetPlatformCredential implements security.CredentialFetcher.
+func (a *AzurePlugin) GetPlatformCredential() (string, error) {
+	u := azureIMDSTokenURL + "?api-version=2018-02-01&resource=" + url.QueryEscape(a.resource)
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata", "true")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("azure imds: failed to fetch managed identity token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("azure imds: token endpoint returned %v", resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	var tokenResp azureIMDSTokenResponse
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return "", fmt.Errorf("azure imds: failed to parse token response: %v", err)
+	}
+	return tokenResp.AccessToken, nil
+}
+
+// GetType implements security.CredentialFetcher.
+func (a *AzurePlugin) GetType() string {
+	return "Azure"
+}
+
+// GetIdentityProvider implements security.CredentialFetcher.
+func (a *AzurePlugin) GetIdentityProvider() string {
+	return "azure"
+}
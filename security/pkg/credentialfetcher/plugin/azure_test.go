@@ -0,0 +1,63 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAzurePluginGetPlatformCredential(t *testing.T) {
+	origURL := azureIMDSTokenURL
+	defer func() { azureIMDSTokenURL = origURL }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" {
+			t.Errorf("request missing Metadata header")
+		}
+		if r.URL.Query().Get("resource") != "https://example.com" {
+			t.Errorf("resource query param = %v, want https://example.com", r.URL.Query().Get("resource"))
+		}
+		w.Write([]byte(`{"access_token":"fake-access-token"}`))
+	}))
+	defer server.Close()
+	azureIMDSTokenURL = server.URL
+
+	p := CreateAzurePlugin("https://example.com")
+	tok, err := p.GetPlatformCredential()
+	if err != nil {
+		t.Fatalf("GetPlatformCredential() returned error: %v", err)
+	}
+	if tok != "fake-access-token" {
+		t.Errorf("GetPlatformCredential() = %v, want fake-access-token", tok)
+	}
+}
+
+func TestAzurePluginGetPlatformCredentialError(t *testing.T) {
+	origURL := azureIMDSTokenURL
+	defer func() { azureIMDSTokenURL = origURL }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	azureIMDSTokenURL = server.URL
+
+	p := CreateAzurePlugin("https://example.com")
+	if _, err := p.GetPlatformCredential(); err == nil {
+		t.Fatalf("GetPlatformCredential() = nil error, want error on non-200 response")
+	}
+}
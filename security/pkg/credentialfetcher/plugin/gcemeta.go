@@ -0,0 +1,77 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// gceMetadataIdentityURL is a var, not a const, so tests can point it at an
+// httptest.Server instead of the real metadata server hostname.
+var gceMetadataIdentityURL = "http://metadata/computeMetadata/v1/instance/service-accounts/default/identity"
+
+// GCEPlugin fetches an identity token for the workload's attached GCE/GKE
+// service account from the instance metadata server - available to any GCE
+// instance regardless of whether GKE workload-identity JWT projection is
+// configured on it.
+type GCEPlugin struct {
+	audience string
+	client   *http.Client
+}
+
+// CreateGCEPlugin returns a security.CredentialFetcher requesting identity
+// tokens scoped to audience (typically the trust domain or CA endpoint).
+func CreateGCEPlugin(audience string) *GCEPlugin {
+	return &GCEPlugin{audience: audience, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+// GetPlatformCredential implements security.CredentialFetcher.
+func (g *GCEPlugin) GetPlatformCredential() (string, error) {
+	u := gceMetadataIdentityURL + "?audience=" + url.QueryEscape(g.audience) + "&format=full"
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("gce metadata: failed to fetch identity token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("gce metadata: identity endpoint returned %v", resp.Status)
+	}
+
+	token, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(token), nil
+}
+
+// GetType implements security.CredentialFetcher.
+func (g *GCEPlugin) GetType() string {
+	return "GoogleComputeEngine"
+}
+
+// GetIdentityProvider implements security.CredentialFetcher.
+func (g *GCEPlugin) GetIdentityProvider() string {
+	return "google"
+}
@@ -0,0 +1,63 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGCEPluginGetPlatformCredential(t *testing.T) {
+	origURL := gceMetadataIdentityURL
+	defer func() { gceMetadataIdentityURL = origURL }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			t.Errorf("request missing Metadata-Flavor header")
+		}
+		if r.URL.Query().Get("audience") != "test-audience" {
+			t.Errorf("audience query param = %v, want test-audience", r.URL.Query().Get("audience"))
+		}
+		w.Write([]byte("fake-identity-token"))
+	}))
+	defer server.Close()
+	gceMetadataIdentityURL = server.URL
+
+	p := CreateGCEPlugin("test-audience")
+	tok, err := p.GetPlatformCredential()
+	if err != nil {
+		t.Fatalf("GetPlatformCredential() returned error: %v", err)
+	}
+	if tok != "fake-identity-token" {
+		t.Errorf("GetPlatformCredential() = %v, want fake-identity-token", tok)
+	}
+}
+
+func TestGCEPluginGetPlatformCredentialError(t *testing.T) {
+	origURL := gceMetadataIdentityURL
+	defer func() { gceMetadataIdentityURL = origURL }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	gceMetadataIdentityURL = server.URL
+
+	p := CreateGCEPlugin("test-audience")
+	if _, err := p.GetPlatformCredential(); err == nil {
+		t.Fatalf("GetPlatformCredential() = nil error, want error on non-200 response")
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// TokenPlugin fetches a credential from a file on disk - a K8s projected
+// service-account token, or any other OIDC file-based token a provisioning
+// tool writes out. It re-reads the file on every call, so rotation by the
+// kubelet projection (or whatever else manages the file) is picked up
+// without restarting the agent.
+type TokenPlugin struct {
+	tokenPath string
+}
+
+// CreateTokenPlugin returns a security.CredentialFetcher reading tokenPath.
+func CreateTokenPlugin(tokenPath string) *TokenPlugin {
+	return &TokenPlugin{tokenPath: tokenPath}
+}
+
+// GetPlatformCredential implements security.CredentialFetcher.
+func (p *TokenPlugin) GetPlatformCredential() (string, error) {
+	tok, err := ioutil.ReadFile(p.tokenPath)
+	if err != nil {
+		return "", fmt.Errorf("onprem: failed to read token file %v: %v", p.tokenPath, err)
+	}
+	return strings.TrimSpace(string(tok)), nil
+}
+
+// GetType implements security.CredentialFetcher.
+func (p *TokenPlugin) GetType() string {
+	return "JWT"
+}
+
+// GetIdentityProvider implements security.CredentialFetcher. A plain file
+// fetcher has no opinion on the identity provider - it's whatever minted the
+// token it reads.
+func (p *TokenPlugin) GetIdentityProvider() string {
+	return ""
+}
@@ -0,0 +1,45 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTokenPluginGetPlatformCredential(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("fake-token\n"), 0o600); err != nil {
+		t.Fatalf("failed to write token file: %v", err)
+	}
+
+	p := CreateTokenPlugin(tokenFile)
+	tok, err := p.GetPlatformCredential()
+	if err != nil {
+		t.Fatalf("GetPlatformCredential() returned error: %v", err)
+	}
+	if tok != "fake-token" {
+		t.Errorf("GetPlatformCredential() = %q, want %q", tok, "fake-token")
+	}
+}
+
+func TestTokenPluginGetPlatformCredentialMissingFile(t *testing.T) {
+	p := CreateTokenPlugin(filepath.Join(t.TempDir(), "does-not-exist"))
+	if _, err := p.GetPlatformCredential(); err == nil {
+		t.Fatalf("GetPlatformCredential() = nil error, want error for a missing token file")
+	}
+}
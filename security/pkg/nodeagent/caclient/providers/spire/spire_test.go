@@ -0,0 +1,38 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spire
+
+import "testing"
+
+func TestNewSPIREClientRequiresSocket(t *testing.T) {
+	if _, err := NewSPIREClient(""); err == nil {
+		t.Fatalf("NewSPIREClient(\"\") = nil error, want error")
+	}
+}
+
+// TestCSRSignAlwaysFails guards against silently reintroducing the
+// cert/key-mismatch bug: CSRSign must never hand back a chain for a keypair
+// it did not sign, so it should fail deterministically - without even
+// needing a SPIRE agent to dial - for any input.
+func TestCSRSignAlwaysFails(t *testing.T) {
+	c, err := NewSPIREClient("unix:///run/spire/sockets/agent.sock")
+	if err != nil {
+		t.Fatalf("NewSPIREClient returned error: %v", err)
+	}
+
+	if _, err := c.CSRSign([]byte("not-even-a-real-csr"), 3600); err == nil {
+		t.Fatalf("CSRSign() = nil error, want error")
+	}
+}
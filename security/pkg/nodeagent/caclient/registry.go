@@ -0,0 +1,58 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package caclient holds the registry of CA provider implementations
+// (security.Client factories), keyed by provider name. Individual providers
+// (citadel, google, spire, vault, ...) register themselves from an init()
+// in their own package, so the agent does not need to special-case each one.
+package caclient
+
+import (
+	"fmt"
+	"sync"
+
+	"istio.io/istio/pkg/security"
+)
+
+// Factory builds a security.Client for a CA provider. rootCert is whatever
+// root of trust the agent already resolved from disk (may be nil, in which
+// case the provider is expected to fall back to the system trust store or
+// its own discovery mechanism).
+type Factory func(opts *security.Options, rootCert []byte) (security.Client, error)
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]Factory{}
+)
+
+// RegisterCAProvider registers factory under name. It panics if name is
+// already registered, since that indicates two provider packages were
+// compiled in with the same name - a build-time programming error, not a
+// runtime condition.
+func RegisterCAProvider(name string, factory Factory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if _, ok := providers[name]; ok {
+		panic(fmt.Sprintf("caclient: CA provider %q already registered", name))
+	}
+	providers[name] = factory
+}
+
+// Lookup returns the factory registered for name, and whether one was found.
+func Lookup(name string) (Factory, bool) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	f, ok := providers[name]
+	return f, ok
+}
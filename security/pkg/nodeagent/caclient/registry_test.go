@@ -0,0 +1,61 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"testing"
+
+	"istio.io/istio/pkg/security"
+)
+
+func TestRegisterAndLookup(t *testing.T) {
+	name := "test-provider"
+	factory := func(opts *security.Options, rootCert []byte) (security.Client, error) {
+		return nil, nil
+	}
+
+	if _, ok := Lookup(name); ok {
+		t.Fatalf("Lookup(%q) found a factory before it was registered", name)
+	}
+
+	RegisterCAProvider(name, factory)
+
+	got, ok := Lookup(name)
+	if !ok {
+		t.Fatalf("Lookup(%q) = not found, want found", name)
+	}
+	if got == nil {
+		t.Fatalf("Lookup(%q) returned a nil factory", name)
+	}
+
+	if _, ok := Lookup("does-not-exist"); ok {
+		t.Fatalf("Lookup(%q) found a factory for an unregistered name", "does-not-exist")
+	}
+}
+
+func TestRegisterCAProviderPanicsOnDuplicate(t *testing.T) {
+	name := "duplicate-provider"
+	factory := func(opts *security.Options, rootCert []byte) (security.Client, error) {
+		return nil, nil
+	}
+	RegisterCAProvider(name, factory)
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatalf("RegisterCAProvider did not panic on duplicate registration of %q", name)
+		}
+	}()
+	RegisterCAProvider(name, factory)
+}